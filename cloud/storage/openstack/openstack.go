@@ -8,9 +8,23 @@ package openstack // import "openstack.upspin.io/cloud/storage/openstack"
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/objectstorage/v1/accounts"
 	"github.com/gophercloud/gophercloud/openstack/objectstorage/v1/containers"
 	"github.com/gophercloud/gophercloud/openstack/objectstorage/v1/objects"
 	"github.com/gophercloud/gophercloud/pagination"
@@ -30,23 +44,75 @@ const (
 	openstackTenantName = "privateOpenstackTenantName"
 	openstackUsername   = "privateOpenstackUsername"
 	openstackPassword   = "privateOpenstackPassword"
+
+	// Keystone v3 options. These let the backend authenticate against
+	// clouds that have moved past the v2 tenant/username/password model,
+	// e.g. with domain-scoped users or application credentials.
+	openstackDomainName                  = "openstackDomainName"
+	openstackDomainID                    = "openstackDomainID"
+	openstackUserDomainName              = "openstackUserDomainName"
+	openstackProjectID                   = "openstackProjectID"
+	openstackProjectDomainName           = "openstackProjectDomainName"
+	openstackToken                       = "privateOpenstackToken"
+	openstackApplicationCredentialID     = "privateOpenstackApplicationCredentialID"
+	openstackApplicationCredentialSecret = "privateOpenstackApplicationCredentialSecret"
+
+	// openstackTempURLKey, if set, overrides the account's
+	// X-Account-Meta-Temp-URL-Key when signing TempURLs. openstackTempURLTTL
+	// is a time.ParseDuration string controlling how long a signed URL
+	// stays valid; it defaults to defaultTempURLTTL.
+	openstackTempURLKey = "openstackTempURLKey"
+	openstackTempURLTTL = "openstackTempURLTTL"
+
+	// openstackSegmentSize, if set, overrides defaultSegmentSize: the
+	// largest object Put will upload in a single PUT before switching to
+	// a Large Object upload. openstackUseDLO selects a Dynamic Large
+	// Object manifest instead of the default Static Large Object one, for
+	// clouds whose Swift doesn't support SLO.
+	openstackSegmentSize = "openstackSegmentSize"
+	openstackUseDLO      = "openstackUseDLO"
+
+	// HTTP transport options, for reaching OpenStack endpoints that need
+	// something other than Go's default HTTP client: a self-signed or
+	// privately-issued TLS certificate, mutual TLS, a non-public catalog
+	// entry, or an egress proxy.
+	openstackInsecureTLS    = "openstackInsecureTLS"
+	openstackCACertFile     = "openstackCACertFile"
+	openstackClientCertFile = "openstackClientCertFile"
+	openstackClientKeyFile  = "openstackClientKeyFile"
+	openstackEndpointType   = "openstackEndpointType"
+	openstackHTTPProxy      = "openstackHTTPProxy"
 )
 
+// defaultTempURLTTL is how long a Swift TempURL is valid for when
+// openstackTempURLTTL isn't set.
+const defaultTempURLTTL = 15 * time.Minute
+
+// defaultSegmentSize is the largest object Put will upload as a single PUT
+// before splitting it into a Large Object, and the size of each of its
+// segments. It sits comfortably under Swift's common 5 GiB single-PUT limit.
+const defaultSegmentSize = 4 << 30 // 4 GiB
+
+// segmentsContainerSuffix names the sibling container that holds the
+// segments of a Large Object, e.g. container "foo" segments to "foo_segments".
+const segmentsContainerSuffix = "_segments"
+
 var requiredOpts = []string{
 	openstackRegion,
 	openstackContainer,
 	openstackAuthURL,
-	openstackTenantName,
-	openstackUsername,
-	openstackPassword,
 }
 
 // See https://docs.openstack.org/swift/latest/overview_acl.html
 const containerPublicACL = ".r:*"
 
 type openstackStorage struct {
-	client    *gophercloud.ServiceClient
-	container string
+	client      *gophercloud.ServiceClient
+	container   string
+	tempURLKey  string
+	tempURLTTL  time.Duration
+	segmentSize int64
+	useDLO      bool
 }
 
 // New creates a new instance of the OpenStack implementation of
@@ -61,25 +127,36 @@ func New(opts *storage.Opts) (storage.Storage, error) {
 		}
 	}
 
-	authOpts := gophercloud.AuthOptions{
-		IdentityEndpoint: opts.Opts[openstackAuthURL],
-		Username:         opts.Opts[openstackUsername],
-		Password:         opts.Opts[openstackPassword],
-		TenantName:       opts.Opts[openstackTenantName],
+	authOpts, err := authOptions(op, opts)
+	if err != nil {
+		return nil, err
 	}
 
-	// When the token expires the services returns 401 and we need to be
-	// able to authenticate again.
-	authOpts.AllowReauth = true
+	httpClient, err := newHTTPClient(op, opts)
+	if err != nil {
+		return nil, err
+	}
 
-	provider, err := openstack.AuthenticatedClient(authOpts)
+	provider, err := openstack.NewClient(authOpts.IdentityEndpoint)
 	if err != nil {
+		return nil, errors.E(op, errors.Invalid, errors.Errorf(
+			"Could not create provider client: %s", err))
+	}
+	provider.HTTPClient = *httpClient
+
+	if err := openstack.Authenticate(provider, authOpts); err != nil {
 		return nil, errors.E(op, errors.Permission, errors.Errorf(
 			"Could not authenticate: %s", err))
 	}
 
+	availability, err := endpointAvailability(op, opts.Opts[openstackEndpointType])
+	if err != nil {
+		return nil, err
+	}
+
 	client, err := openstack.NewObjectStorageV1(provider, gophercloud.EndpointOpts{
-		Region: opts.Opts[openstackRegion],
+		Region:       opts.Opts[openstackRegion],
+		Availability: availability,
 	})
 	if err != nil {
 		// The error kind is "Invalid" because AFAICS this can only
@@ -88,12 +165,187 @@ func New(opts *storage.Opts) (storage.Storage, error) {
 			"Could not create object storage client: %s", err))
 	}
 
+	tempURLTTL := defaultTempURLTTL
+	if s := opts.Opts[openstackTempURLTTL]; s != "" {
+		tempURLTTL, err = time.ParseDuration(s)
+		if err != nil {
+			return nil, errors.E(op, errors.Invalid, errors.Errorf(
+				"Invalid %q: %s", openstackTempURLTTL, err))
+		}
+	}
+
+	segmentSize := int64(defaultSegmentSize)
+	if s := opts.Opts[openstackSegmentSize]; s != "" {
+		segmentSize, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, errors.E(op, errors.Invalid, errors.Errorf(
+				"Invalid %q: %s", openstackSegmentSize, err))
+		}
+		if segmentSize <= 0 {
+			return nil, errors.E(op, errors.Invalid, errors.Errorf(
+				"Invalid %q: must be positive, got %d", openstackSegmentSize, segmentSize))
+		}
+	}
+
+	useDLO := false
+	if s := opts.Opts[openstackUseDLO]; s != "" {
+		useDLO, err = strconv.ParseBool(s)
+		if err != nil {
+			return nil, errors.E(op, errors.Invalid, errors.Errorf(
+				"Invalid %q: %s", openstackUseDLO, err))
+		}
+	}
+
 	return &openstackStorage{
-		client:    client,
-		container: opts.Opts[openstackContainer],
+		client:      client,
+		container:   opts.Opts[openstackContainer],
+		tempURLKey:  opts.Opts[openstackTempURLKey],
+		tempURLTTL:  tempURLTTL,
+		segmentSize: segmentSize,
+		useDLO:      useDLO,
 	}, nil
 }
 
+// authOptions builds the gophercloud.AuthOptions to use from the given
+// storage options. It supports the classic v2-style tenant/username/password
+// combination as well as Keystone v3 domain-scoped users, pre-issued tokens
+// and application credentials, so that callers on modern OpenStack clouds
+// aren't forced into any particular auth flow.
+func authOptions(op string, opts *storage.Opts) (gophercloud.AuthOptions, error) {
+	token := opts.Opts[openstackToken]
+	appCredID := opts.Opts[openstackApplicationCredentialID]
+	appCredSecret := opts.Opts[openstackApplicationCredentialSecret]
+
+	if token == "" && appCredID == "" {
+		for _, opt := range []string{openstackTenantName, openstackUsername, openstackPassword} {
+			if opts.Opts[opt] == "" {
+				return gophercloud.AuthOptions{}, errors.E(op, errors.Invalid, errors.Errorf(
+					"%q option is required unless %q or %q is given",
+					opt, openstackToken, openstackApplicationCredentialID))
+			}
+		}
+	}
+
+	authOpts := gophercloud.AuthOptions{
+		IdentityEndpoint:            opts.Opts[openstackAuthURL],
+		Username:                    opts.Opts[openstackUsername],
+		Password:                    opts.Opts[openstackPassword],
+		TenantName:                  opts.Opts[openstackTenantName],
+		TenantID:                    opts.Opts[openstackProjectID],
+		DomainName:                  opts.Opts[openstackDomainName],
+		DomainID:                    opts.Opts[openstackDomainID],
+		TokenID:                     token,
+		ApplicationCredentialID:     appCredID,
+		ApplicationCredentialSecret: appCredSecret,
+	}
+
+	// A user domain that differs from the project's domain (common with
+	// application credentials scoped to a different domain) overrides the
+	// plain domain name/ID used to disambiguate the user.
+	if userDomainName := opts.Opts[openstackUserDomainName]; userDomainName != "" {
+		authOpts.DomainName = userDomainName
+		authOpts.DomainID = ""
+	}
+
+	if projectID := authOpts.TenantID; projectID != "" {
+		// A Scope with ProjectID set may not also carry ProjectName,
+		// DomainID or DomainName: the project ID alone is enough to
+		// disambiguate it.
+		authOpts.Scope = &gophercloud.AuthScope{ProjectID: projectID}
+	} else if opts.Opts[openstackProjectDomainName] != "" {
+		authOpts.Scope = &gophercloud.AuthScope{
+			ProjectName: authOpts.TenantName,
+			DomainName:  opts.Opts[openstackProjectDomainName],
+		}
+	}
+
+	// When the token expires the services returns 401 and we need to be
+	// able to authenticate again.
+	authOpts.AllowReauth = true
+
+	return authOpts, nil
+}
+
+// newHTTPClient builds the *http.Client the provider and service clients
+// should use, configured from the given storage options for TLS
+// verification, a custom CA or client certificate, and an HTTP proxy.
+func newHTTPClient(op string, opts *storage.Opts) (*http.Client, error) {
+	tlsConfig := &tls.Config{}
+
+	if insecure := opts.Opts[openstackInsecureTLS]; insecure != "" {
+		v, err := strconv.ParseBool(insecure)
+		if err != nil {
+			return nil, errors.E(op, errors.Invalid, errors.Errorf(
+				"Invalid %q: %s", openstackInsecureTLS, err))
+		}
+		tlsConfig.InsecureSkipVerify = v
+	}
+
+	if caCertFile := opts.Opts[openstackCACertFile]; caCertFile != "" {
+		pem, err := ioutil.ReadFile(caCertFile)
+		if err != nil {
+			return nil, errors.E(op, errors.IO, errors.Errorf(
+				"Unable to read %q: %s", openstackCACertFile, err))
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.E(op, errors.Invalid, errors.Errorf(
+				"%q does not contain a valid PEM certificate", caCertFile))
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	certFile := opts.Opts[openstackClientCertFile]
+	keyFile := opts.Opts[openstackClientKeyFile]
+	if certFile != "" && keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, errors.E(op, errors.Invalid, errors.Errorf(
+				"Unable to load client certificate: %s", err))
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	} else if certFile != "" || keyFile != "" {
+		return nil, errors.E(op, errors.Invalid, errors.Errorf(
+			"%q and %q must be given together", openstackClientCertFile, openstackClientKeyFile))
+	}
+
+	// Clone, rather than zero-value, http.DefaultTransport so deployments
+	// that don't set any of the options above keep its behavior: proxying
+	// via the HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment variables and a
+	// bounded dial timeout.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	if proxy := opts.Opts[openstackHTTPProxy]; proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			return nil, errors.E(op, errors.Invalid, errors.Errorf(
+				"Invalid %q: %s", openstackHTTPProxy, err))
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// endpointAvailability maps the openstackEndpointType option to the
+// gophercloud.Availability to look up in the service catalog, defaulting to
+// the public endpoint.
+func endpointAvailability(op, endpointType string) (gophercloud.Availability, error) {
+	switch endpointType {
+	case "", "public":
+		return gophercloud.AvailabilityPublic, nil
+	case "internal":
+		return gophercloud.AvailabilityInternal, nil
+	case "admin":
+		return gophercloud.AvailabilityAdmin, nil
+	default:
+		return "", errors.E(op, errors.Invalid, errors.Errorf(
+			"Invalid %q: %q (want %q, %q or %q)",
+			openstackEndpointType, endpointType, "public", "internal", "admin"))
+	}
+}
+
 func init() {
 	err := storage.Register(storageName, New)
 	if err != nil {
@@ -111,6 +363,14 @@ var (
 // LinkBase will return the URL if the container has read access for everybody
 // and an unsupported error in case it does not. Still, it might return an
 // error because it can't get the necessary metadata.
+//
+// LinkBase cannot help with a private container: its contract is that
+// callers build a link by concatenating the returned base with a ref chosen
+// later, but a Swift TempURL signature authenticates one specific object
+// path and must appear in a query string trailing that path, so there is no
+// base string that stays valid once an arbitrary ref is appended after it.
+// Callers that hold a private container's objects should call SignedURL
+// per ref instead.
 func (s *openstackStorage) LinkBase() (string, error) {
 	const op = "cloud/storage/openstack.LinkBase"
 
@@ -128,6 +388,61 @@ func (s *openstackStorage) LinkBase() (string, error) {
 	return "", upspin.ErrNotSupported
 }
 
+// SignedURL returns a Swift TempURL granting GET access to ref for ttl, so
+// that callers can hand out temporary links into a private container without
+// making it public. If ttl is zero, the container's configured TempURL TTL
+// (see openstackTempURLTTL) is used.
+//
+// Signing requires a Temp-URL key, taken from the openstackTempURLKey option
+// if set, or else read from the container's account-level
+// X-Account-Meta-Temp-URL-Key metadata.
+func (s *openstackStorage) SignedURL(ref string, ttl time.Duration) (string, error) {
+	const op = "cloud/storage/openstack.SignedURL"
+
+	key, err := s.tempURLSigningKey()
+	if err != nil {
+		return "", errors.E(op, errors.IO, errors.Errorf(
+			"Unable to fetch account metadata: %s", err))
+	}
+	if key == "" {
+		return "", errors.E(op, errors.Invalid, errors.Errorf(
+			"no Temp-URL key configured for account; set %q or "+
+				"X-Account-Meta-Temp-URL-Key", openstackTempURLKey))
+	}
+
+	if ttl <= 0 {
+		ttl = s.tempURLTTL
+	}
+
+	rawURL := s.client.ServiceURL(s.container, ref)
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", errors.E(op, errors.Internal, err)
+	}
+
+	expires := time.Now().Add(ttl).Unix()
+	toSign := fmt.Sprintf("GET\n%d\n%s", expires, u.Path)
+	mac := hmac.New(sha1.New, []byte(key))
+	mac.Write([]byte(toSign))
+	sig := hex.EncodeToString(mac.Sum(nil))
+
+	return fmt.Sprintf("%s?temp_url_sig=%s&temp_url_expires=%d", rawURL, sig, expires), nil
+}
+
+// tempURLSigningKey returns the key to use when signing TempURLs, preferring
+// the locally configured key over the account's metadata.
+func (s *openstackStorage) tempURLSigningKey() (string, error) {
+	if s.tempURLKey != "" {
+		return s.tempURLKey, nil
+	}
+	r := accounts.Get(s.client, nil)
+	h, err := r.Extract()
+	if err != nil {
+		return "", err
+	}
+	return h.TempURLKey, nil
+}
+
 func (s *openstackStorage) Download(ref string) ([]byte, error) {
 	const op = "cloud/storage/openstack.Download"
 
@@ -146,6 +461,10 @@ func (s *openstackStorage) Download(ref string) ([]byte, error) {
 func (s *openstackStorage) Put(ref string, contents []byte) error {
 	const op = "cloud/storage/openstack.Put"
 
+	if int64(len(contents)) > s.segmentSize {
+		return s.putLargeObject(op, ref, contents)
+	}
+
 	opts := objects.CreateOpts{Content: bytes.NewReader(contents)}
 	err := objects.Create(s.client, s.container, ref, opts).Err
 	if err != nil {
@@ -155,10 +474,115 @@ func (s *openstackStorage) Put(ref string, contents []byte) error {
 	return nil
 }
 
+// segmentsContainer is the sibling container that holds ref's segments when
+// it is uploaded as a Large Object.
+func (s *openstackStorage) segmentsContainer() string {
+	return s.container + segmentsContainerSuffix
+}
+
+// sloSegment describes one segment of a Static Large Object manifest.
+type sloSegment struct {
+	Path      string `json:"path"`
+	ETag      string `json:"etag"`
+	SizeBytes int64  `json:"size_bytes"`
+}
+
+// putLargeObject uploads contents as a sequence of segments of at most
+// s.segmentSize bytes each, then writes a manifest object at ref that ties
+// them together as either a Static or a Dynamic Large Object, depending on
+// s.useDLO.
+func (s *openstackStorage) putLargeObject(op, ref string, contents []byte) error {
+	h, err := containers.Get(s.client, s.container).Extract()
+	if err != nil {
+		return errors.E(op, errors.IO, errors.Errorf(
+			"Unable to read ACL of container %q: %s", s.container, err))
+	}
+
+	// The segments container needs the same read ACL as s.container,
+	// since fetching a Large Object's manifest also fetches its
+	// segments, which are subject to the segments container's own ACL.
+	segContainer := s.segmentsContainer()
+	segOpts := containers.CreateOpts{ContainerRead: strings.Join(h.Read, ",")}
+	if err := containers.Create(s.client, segContainer, segOpts).Err; err != nil {
+		return errors.E(op, errors.IO, errors.Errorf(
+			"Unable to create segments container %q: %s", segContainer, err))
+	}
+
+	var segments []sloSegment
+	for off, i := int64(0), 0; off < int64(len(contents)); off, i = off+s.segmentSize, i+1 {
+		end := off + s.segmentSize
+		if end > int64(len(contents)) {
+			end = int64(len(contents))
+		}
+		segment := contents[off:end]
+		// Zero-pad the index so that name order, which a DLO uses to
+		// concatenate its segments, is also upload order.
+		segName := fmt.Sprintf("%s/%08d", ref, i)
+
+		r := objects.Create(s.client, segContainer, segName, objects.CreateOpts{
+			Content: bytes.NewReader(segment),
+		})
+		h, err := r.Extract()
+		if err != nil {
+			return errors.E(op, errors.IO, errors.Errorf(
+				"Unable to upload segment %q to container %q: %s", segName, segContainer, err))
+		}
+		segments = append(segments, sloSegment{
+			Path:      fmt.Sprintf("%s/%s", segContainer, segName),
+			ETag:      h.ETag,
+			SizeBytes: int64(len(segment)),
+		})
+	}
+
+	if s.useDLO {
+		opts := objects.CreateOpts{
+			Content:        bytes.NewReader(nil),
+			ObjectManifest: fmt.Sprintf("%s/%s/", segContainer, ref),
+		}
+		if err := objects.Create(s.client, s.container, ref, opts).Err; err != nil {
+			return errors.E(op, errors.IO, errors.Errorf(
+				"Unable to upload DLO manifest for ref %q: %s", ref, err))
+		}
+		return nil
+	}
+
+	manifest, err := json.Marshal(segments)
+	if err != nil {
+		return errors.E(op, errors.Internal, err)
+	}
+	opts := objects.CreateOpts{
+		Content:           bytes.NewReader(manifest),
+		MultipartManifest: "put",
+	}
+	if err := objects.Create(s.client, s.container, ref, opts).Err; err != nil {
+		return errors.E(op, errors.IO, errors.Errorf(
+			"Unable to upload SLO manifest for ref %q: %s", ref, err))
+	}
+	return nil
+}
+
 func (s *openstackStorage) Delete(ref string) error {
 	const op = "cloud/storage/openstack.Delete"
 
-	err := objects.Delete(s.client, s.container, ref, nil).Err
+	segContainer, segPrefix, err := s.dloManifest(ref)
+	if err != nil {
+		return errors.E(op, errors.IO, errors.Errorf(
+			"Unable to check ref %q for a DLO manifest: %s", ref, err))
+	}
+	if segContainer != "" {
+		if err := s.deleteSegments(segContainer, segPrefix); err != nil {
+			return errors.E(op, errors.IO, errors.Errorf(
+				"Unable to delete segments of ref %q: %s", ref, err))
+		}
+	}
+
+	// multipart-manifest=delete removes both the manifest and all its
+	// segments in one request when ref is a Static Large Object; for a
+	// Dynamic Large Object it only removes the manifest, which is why its
+	// segments, if any, were just deleted explicitly above. Swift ignores
+	// the parameter for ordinary objects.
+	opts := objects.DeleteOpts{MultipartManifest: "delete"}
+	err = objects.Delete(s.client, s.container, ref, opts).Err
 	if err != nil {
 		return errors.E(op, errors.IO, errors.Errorf(
 			"Unable to delete ref %q from container %q: %s", ref, s.container, err))
@@ -166,6 +590,127 @@ func (s *openstackStorage) Delete(ref string) error {
 	return nil
 }
 
+// dloManifest returns the segments container and object name prefix that
+// ref's X-Object-Manifest header points to, or "", "", nil if ref has no
+// such header (including if ref doesn't exist, so Delete can still report
+// the failure of the delete itself).
+func (s *openstackStorage) dloManifest(ref string) (segContainer, segPrefix string, err error) {
+	h, err := objects.Get(s.client, s.container, ref, nil).Extract()
+	if err != nil {
+		if _, ok := err.(gophercloud.ErrDefault404); ok {
+			return "", "", nil
+		}
+		return "", "", err
+	}
+	if h.ObjectManifest == "" {
+		return "", "", nil
+	}
+	parts := strings.SplitN(h.ObjectManifest, "/", 2)
+	if len(parts) != 2 {
+		return "", "", errors.Errorf("malformed X-Object-Manifest %q", h.ObjectManifest)
+	}
+	return parts[0], parts[1], nil
+}
+
+// deleteSegments deletes every object in segContainer whose name begins with
+// segPrefix, e.g. all the segments of a Dynamic Large Object.
+func (s *openstackStorage) deleteSegments(segContainer, segPrefix string) error {
+	var segRefs []string
+	pager := objects.List(s.client, segContainer, objects.ListOpts{Prefix: segPrefix})
+	err := pager.EachPage(func(page pagination.Page) (bool, error) {
+		names, err := objects.ExtractNames(page)
+		if err != nil {
+			return false, err
+		}
+		segRefs = append(segRefs, names...)
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, segRef := range segRefs {
+		if err := objects.Delete(s.client, segContainer, segRef, nil).Err; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxBulkDeleteRefs is the most refs DeleteMany will put in a single
+// bulk-delete request, per Swift's own limit on the operation.
+const maxBulkDeleteRefs = 10000
+
+// bulkDeleteResponse is the body Swift's bulk-delete middleware returns.
+type bulkDeleteResponse struct {
+	NumberDeleted  int        `json:"Number Deleted"`
+	NumberNotFound int        `json:"Number Not Found"`
+	ResponseStatus string     `json:"Response Status"`
+	Errors         [][]string `json:"Errors"`
+}
+
+// DeleteMany deletes up to len(refs) objects from the container in batches of
+// at most maxBulkDeleteRefs, using Swift's bulk-delete endpoint instead of
+// one DELETE per ref. If any deletes in a batch fail, it returns an error
+// listing them and does not send the later batches: the refs of that batch
+// not mentioned in the error, and the refs of earlier batches, were deleted.
+func (s *openstackStorage) DeleteMany(refs []string) error {
+	const op = "cloud/storage/openstack.DeleteMany"
+
+	for len(refs) > 0 {
+		batch := refs
+		if len(batch) > maxBulkDeleteRefs {
+			batch = batch[:maxBulkDeleteRefs]
+		}
+		refs = refs[len(batch):]
+
+		var body bytes.Buffer
+		for _, ref := range batch {
+			fmt.Fprintf(&body, "%s/%s\n", url.PathEscape(s.container), url.PathEscape(ref))
+		}
+
+		resp, err := s.client.ProviderClient.Request("POST", s.client.ServiceURL()+"?bulk-delete=true", &gophercloud.RequestOpts{
+			RawBody: &body,
+			MoreHeaders: map[string]string{
+				"Content-Type": "text/plain",
+				"Accept":       "application/json",
+			},
+			OkCodes: []int{200},
+		})
+		if err != nil {
+			return errors.E(op, errors.IO, errors.Errorf(
+				"Unable to bulk-delete %d refs from container %q: %s", len(batch), s.container, err))
+		}
+		var result bulkDeleteResponse
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return errors.E(op, errors.IO, errors.Errorf(
+				"Unable to parse bulk-delete response from container %q: %s", s.container, err))
+		}
+		if len(result.Errors) > 0 {
+			return errors.E(op, errors.IO, errors.Errorf(
+				"%d of %d deletes from container %q failed: %v",
+				len(result.Errors), len(batch), s.container, result.Errors))
+		}
+	}
+	return nil
+}
+
+// Copy copies srcRef to dstRef within the container using Swift's
+// server-side COPY verb, so the bytes never have to pass through this
+// process.
+func (s *openstackStorage) Copy(srcRef, dstRef string) error {
+	const op = "cloud/storage/openstack.Copy"
+
+	opts := objects.CopyOpts{Destination: fmt.Sprintf("/%s/%s", s.container, dstRef)}
+	err := objects.Copy(s.client, s.container, srcRef, opts).Err
+	if err != nil {
+		return errors.E(op, errors.IO, errors.Errorf(
+			"Unable to copy ref %q to %q in container %q: %s", srcRef, dstRef, s.container, err))
+	}
+	return nil
+}
+
 func (s *openstackStorage) pager(url string, perPage int) pagination.Pager {
 	// First page, can use objects.List().
 	if url == "" {
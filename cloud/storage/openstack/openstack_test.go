@@ -5,16 +5,25 @@
 package openstack
 
 import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack"
 	"github.com/gophercloud/gophercloud/openstack/objectstorage/v1/containers"
+	"github.com/gophercloud/gophercloud/openstack/objectstorage/v1/objects"
+	"github.com/gophercloud/gophercloud/pagination"
 
 	"upspin.io/cloud/storage"
 	"upspin.io/errors"
@@ -37,9 +46,24 @@ var (
 	testContainer = flag.String("test_container", defaultTestContainer, "container to use for testing")
 
 	useOpenStack = flag.Bool("use_openstack", false, "enable to run OpenStack tests; requires OpenStack credentials")
+
+	// Keystone v3 flags, for clouds that need domain-scoped auth, a
+	// pre-issued token, or an application credential instead of the
+	// classic tenant/username/password triple picked up from the
+	// environment below.
+	testDomainName                  = flag.String("test_domain_name", "", "domain name to use for Keystone v3 auth")
+	testDomainID                    = flag.String("test_domain_id", "", "domain ID to use for Keystone v3 auth")
+	testUserDomainName              = flag.String("test_user_domain_name", "", "user domain name to use for Keystone v3 auth")
+	testProjectID                   = flag.String("test_project_id", "", "project ID to use for Keystone v3 auth")
+	testProjectDomainName           = flag.String("test_project_domain_name", "", "project domain name to use for Keystone v3 auth")
+	testToken                       = flag.String("test_token", "", "pre-issued token to use instead of tenant/username/password")
+	testApplicationCredentialID     = flag.String("test_application_credential_id", "", "application credential ID to use instead of tenant/username/password")
+	testApplicationCredentialSecret = flag.String("test_application_credential_secret", "", "application credential secret to use instead of tenant/username/password")
 )
 
 func TestPutAndDownloadFromLinkBase(t *testing.T) {
+	requireOpenStack(t)
+
 	err := client.Put(objectName, objectContents)
 	if err != nil {
 		t.Fatalf("Could not put: %v", err)
@@ -62,7 +86,97 @@ func TestPutAndDownloadFromLinkBase(t *testing.T) {
 	}
 }
 
+func TestPutLargeObject(t *testing.T) {
+	requireOpenStack(t)
+
+	s := *client.(*openstackStorage)
+	s.segmentSize = 16 // force a multi-segment upload for this tiny payload
+
+	ref := fmt.Sprintf("large-%d", time.Now().Second())
+	contents := []byte(strings.Repeat("0123456789abcdef", 10)) // 160 bytes, 10 segments
+
+	if err := s.Put(ref, contents); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	defer s.Delete(ref)
+
+	got, err := s.Download(ref)
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	if string(got) != string(contents) {
+		t.Errorf("Downloaded contents do not match, wanted %q got %q", contents, got)
+	}
+
+	base, err := s.LinkBase()
+	if err != nil {
+		t.Fatalf("LinkBase: %v", err)
+	}
+	response, err := http.Get(base + ref)
+	if err != nil {
+		t.Fatalf("Could not get from container base: %v", err)
+	}
+	viaLinkBase, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("Could not read response body: %v", err)
+	}
+	if string(viaLinkBase) != string(contents) {
+		t.Errorf("Downloaded contents via LinkBase do not match, wanted %q got %q", contents, viaLinkBase)
+	}
+}
+
+func TestPutLargeObjectDLO(t *testing.T) {
+	requireOpenStack(t)
+
+	s := *client.(*openstackStorage)
+	s.segmentSize = 16 // force a multi-segment upload for this tiny payload
+	s.useDLO = true
+
+	ref := fmt.Sprintf("large-dlo-%d", time.Now().Second())
+	contents := []byte(strings.Repeat("0123456789abcdef", 10)) // 160 bytes, 10 segments
+
+	if err := s.Put(ref, contents); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	got, err := s.Download(ref)
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	if string(got) != string(contents) {
+		t.Errorf("Downloaded contents do not match, wanted %q got %q", contents, got)
+	}
+
+	if err := s.Delete(ref); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	// Delete must have removed the segments along with the manifest, not
+	// just orphaned them in the segments container.
+	if _, err := s.Download(ref); err == nil {
+		t.Fatal("Expected an error downloading deleted DLO manifest, got none")
+	}
+	segContainer := s.segmentsContainer()
+	pager := objects.List(s.client, segContainer, objects.ListOpts{Prefix: ref + "/"})
+	var remaining []string
+	if err := pager.EachPage(func(page pagination.Page) (bool, error) {
+		names, err := objects.ExtractNames(page)
+		if err != nil {
+			return false, err
+		}
+		remaining = append(remaining, names...)
+		return true, nil
+	}); err != nil {
+		t.Fatalf("Listing segments: %v", err)
+	}
+	if len(remaining) != 0 {
+		t.Errorf("Delete left %d DLO segments behind: %v", len(remaining), remaining)
+	}
+}
+
 func TestDownloadMissing(t *testing.T) {
+	requireOpenStack(t)
+
 	_, err := client.Download("Something I never uploaded")
 	uerr, ok := err.(*errors.Error)
 	if !ok {
@@ -74,6 +188,8 @@ func TestDownloadMissing(t *testing.T) {
 }
 
 func TestPutAndDownload(t *testing.T) {
+	requireOpenStack(t)
+
 	err := client.Put(objectName, objectContents)
 	if err != nil {
 		t.Fatalf("Could not put: %v", err)
@@ -89,6 +205,8 @@ func TestPutAndDownload(t *testing.T) {
 }
 
 func TestPutAndDelete(t *testing.T) {
+	requireOpenStack(t)
+
 	err := client.Put(objectName, objectContents)
 	if err != nil {
 		t.Fatal(err)
@@ -103,7 +221,106 @@ func TestPutAndDelete(t *testing.T) {
 	}
 }
 
+func TestCopy(t *testing.T) {
+	requireOpenStack(t)
+
+	s := client.(*openstackStorage)
+	dst := objectName + "-copy"
+
+	if err := s.Put(objectName, objectContents); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Copy(objectName, dst); err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+	defer s.Delete(dst)
+
+	got, err := s.Download(dst)
+	if err != nil {
+		t.Fatalf("Download copy: %v", err)
+	}
+	if string(got) != string(objectContents) {
+		t.Errorf("Downloaded copy contents do not match, wanted %q got %q", objectContents, got)
+	}
+}
+
+// TestNewHTTPClientInsecureTLS doesn't need live OpenStack access: it
+// verifies that openstackInsecureTLS lets the client talk to a server
+// presenting a certificate it wouldn't otherwise trust.
+func TestNewHTTPClientInsecureTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	secure, err := newHTTPClient("test", &storage.Opts{Opts: map[string]string{}})
+	if err != nil {
+		t.Fatalf("newHTTPClient: %v", err)
+	}
+	if _, err := secure.Get(server.URL); err == nil {
+		t.Fatal("expected an error verifying the test server's certificate, got none")
+	}
+
+	insecure, err := newHTTPClient("test", &storage.Opts{Opts: map[string]string{
+		openstackInsecureTLS: "true",
+	}})
+	if err != nil {
+		t.Fatalf("newHTTPClient: %v", err)
+	}
+	resp, err := insecure.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get with insecure client: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+// TestSignedURL doesn't need live OpenStack access: it exercises the HMAC
+// signing logic directly against a storage instance pointed at a fake
+// endpoint.
+func TestSignedURL(t *testing.T) {
+	s := &openstackStorage{
+		client: &gophercloud.ServiceClient{
+			ProviderClient: &gophercloud.ProviderClient{},
+			Endpoint:       "https://swift.example.com/v1/AUTH_test/",
+		},
+		container:  "mycontainer",
+		tempURLKey: "supersecretkey",
+		tempURLTTL: defaultTempURLTTL,
+	}
+
+	signed, err := s.SignedURL("myref", time.Minute)
+	if err != nil {
+		t.Fatalf("SignedURL: %v", err)
+	}
+
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("Could not parse signed URL: %v", err)
+	}
+	sig := u.Query().Get("temp_url_sig")
+	expires := u.Query().Get("temp_url_expires")
+	if sig == "" || expires == "" {
+		t.Fatalf("SignedURL %q missing temp_url_sig or temp_url_expires", signed)
+	}
+	if !strings.HasPrefix(signed, "https://swift.example.com/v1/AUTH_test/mycontainer/myref?") {
+		t.Errorf("SignedURL = %q, want one rooted at the object path", signed)
+	}
+
+	toSign := fmt.Sprintf("GET\n%s\n%s", expires, u.Path)
+	mac := hmac.New(sha1.New, []byte(s.tempURLKey))
+	mac.Write([]byte(toSign))
+	want := hex.EncodeToString(mac.Sum(nil))
+	if sig != want {
+		t.Errorf("temp_url_sig = %q, want %q", sig, want)
+	}
+}
+
 func TestListingEmptyContainer(t *testing.T) {
+	requireOpenStack(t)
+
 	l := client.(*openstackStorage)
 	refs, nextToken, err := l.List("")
 	if err != nil {
@@ -118,6 +335,8 @@ func TestListingEmptyContainer(t *testing.T) {
 }
 
 func TestListingWithPagination(t *testing.T) {
+	requireOpenStack(t)
+
 	putRefs := make([]string, 10)
 	for i := 0; i < 10; i++ {
 		ref := fmt.Sprintf("ref%d", i)
@@ -127,12 +346,9 @@ func TestListingWithPagination(t *testing.T) {
 		}
 	}
 
-	// Try to clean up so the container can be deleted.
-	defer func() {
-		for _, ref := range putRefs {
-			client.Delete(ref)
-		}
-	}()
+	// Clean up in a single bulk-delete request instead of one DELETE per
+	// ref, so the container can be deleted.
+	defer client.(*openstackStorage).DeleteMany(putRefs)
 
 	refs, callCount, err := getAllRefs(3, len(putRefs))
 	if err != nil {
@@ -163,18 +379,21 @@ func getAllRefs(perPage int, maxCalls int) (allRefs []upspin.ListRefsItem, callC
 	return
 }
 
-func TestMain(m *testing.M) {
-	flag.Parse()
+// requireOpenStack skips t unless -use_openstack was passed, for tests that
+// need the live client TestMain sets up.
+func requireOpenStack(t *testing.T) {
 	if !*useOpenStack {
-		log.Printf(`
-
-cloud/storage/openstack: skipping test as it requires OpenStack access. To
+		t.Skip(`cloud/storage/openstack: skipping test as it requires OpenStack access. To
 enable this test, ensure you are properly authorized to upload to an OpenStack
 container named by flag -test_container and then set this test's flag
--use_openstack.
+-use_openstack.`)
+	}
+}
 
-`)
-		os.Exit(0)
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if !*useOpenStack {
+		os.Exit(m.Run())
 	}
 
 	// Create client that writes to test container.
@@ -185,15 +404,32 @@ container named by flag -test_container and then set this test's flag
 	if err != nil {
 		log.Fatalf("cloud/storage/openstack: could not get auth opts from env: %v", err)
 	}
-	client, err = storage.Dial(
-		"OpenStack",
+	opts := []storage.DialOpts{
 		storage.WithKeyValue("openstackRegion", *testRegion),
 		storage.WithKeyValue("openstackContainer", *testContainer),
 		storage.WithKeyValue("openstackAuthURL", ao.IdentityEndpoint),
 		storage.WithKeyValue("privateOpenstackTenantName", ao.TenantName),
 		storage.WithKeyValue("privateOpenstackUsername", ao.Username),
 		storage.WithKeyValue("privateOpenstackPassword", ao.Password),
-	)
+	}
+	// The Keystone v3 flags are optional; only pass them along if the
+	// caller set them, since the v2-style opts above are enough to
+	// authenticate against clouds that don't need them.
+	for k, v := range map[string]string{
+		"openstackDomainName":                         *testDomainName,
+		"openstackDomainID":                           *testDomainID,
+		"openstackUserDomainName":                     *testUserDomainName,
+		"openstackProjectID":                          *testProjectID,
+		"openstackProjectDomainName":                  *testProjectDomainName,
+		"privateOpenstackToken":                       *testToken,
+		"privateOpenstackApplicationCredentialID":     *testApplicationCredentialID,
+		"privateOpenstackApplicationCredentialSecret": *testApplicationCredentialSecret,
+	} {
+		if v != "" {
+			opts = append(opts, storage.WithKeyValue(k, v))
+		}
+	}
+	client, err = storage.Dial("OpenStack", opts...)
 	if err != nil {
 		log.Fatalf("cloud/storage/openstack: couldn't set up client: %v", err)
 	}